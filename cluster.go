@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildClusterConfigs resolves one *rest.Config per cluster to fan in
+// from, keyed by cluster name. kubeconfigDir takes precedence when set,
+// loading every file in the directory as its own cluster named after the
+// file. Otherwise kubeconfig is loaded once and split into one cluster
+// per entry in contexts (a comma-separated list; the empty string means
+// "just the current context"). With neither set, the in-cluster config
+// is used under the cluster name "in-cluster".
+func buildClusterConfigs(kubeconfig, contexts, kubeconfigDir string) (map[string]*rest.Config, error) {
+	if kubeconfigDir != "" {
+		return buildClusterConfigsFromDir(kubeconfigDir)
+	}
+
+	if kubeconfig == "" {
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get in-cluster config: %w", err)
+		}
+		return map[string]*rest.Config{"in-cluster": cfg}, nil
+	}
+
+	loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
+	if contexts == "" {
+		cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("load kubeconfig %s: %w", kubeconfig, err)
+		}
+		rawCfg, err := loadingRules.Load()
+		if err != nil {
+			return nil, fmt.Errorf("load kubeconfig %s: %w", kubeconfig, err)
+		}
+		name := rawCfg.CurrentContext
+		if name == "" {
+			name = "default"
+		}
+		return map[string]*rest.Config{name: cfg}, nil
+	}
+
+	configs := make(map[string]*rest.Config)
+	for _, ctxName := range strings.Split(contexts, ",") {
+		ctxName = strings.TrimSpace(ctxName)
+		if ctxName == "" {
+			continue
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: ctxName}
+		cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("load context %s from kubeconfig %s: %w", ctxName, kubeconfig, err)
+		}
+		configs[ctxName] = cfg
+	}
+	return configs, nil
+}
+
+// buildClusterConfigsFromDir loads one cluster per file in dir, named
+// after the file with its extension stripped, for fanning in clusters
+// whose kubeconfigs aren't merged into a single file.
+func buildClusterConfigsFromDir(dir string) (map[string]*rest.Config, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read kubeconfig-dir %s: %w", dir, err)
+	}
+
+	configs := make(map[string]*rest.Config)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		cfg, err := clientcmd.BuildConfigFromFlags("", path)
+		if err != nil {
+			return nil, fmt.Errorf("load kubeconfig %s: %w", path, err)
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		configs[name] = cfg
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("kubeconfig-dir %s contains no files", dir)
+	}
+	return configs, nil
+}
+
+// terminationInfo extracts the reason and exit code cs's container
+// terminated with, from LastTerminationState, for tagging the
+// corresponding previous-log fetch. Returns "", 0 if the status carries
+// no terminated state (shouldn't happen for a container whose
+// RestartCount just went up, but status is best-effort).
+func terminationInfo(cs v1.ContainerStatus) (reason string, exitCode int32) {
+	t := cs.LastTerminationState.Terminated
+	if t == nil {
+		return "", 0
+	}
+	return t.Reason, t.ExitCode
+}
+
+// runCluster wires up the pod informer for one cluster and keeps it
+// running until stopCh closes, starting and stopping a LogStreamer per
+// watched container along the way. It signals synced once the informer's
+// cache has done its initial sync, then blocks until stopCh closes.
+func runCluster(cluster string, clientset *kubernetes.Clientset, ns, selector string, regex *regexp.Regexp, mode string, sinceSec int64, sink Sink, health *healthServer, synced chan<- struct{}, stopCh <-chan struct{}) {
+	lsMap := make(map[string]*LogStreamer)
+	var mu sync.Mutex
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(ns),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			if selector != "" {
+				o.LabelSelector = selector
+			}
+		}),
+	)
+	podInformer := factory.Core().V1().Pods().Informer()
+	podLister := factory.Core().V1().Pods().Lister()
+
+	// registerContainers starts a LogStreamer for every container in
+	// pod's spec that doesn't already have one. Called from both AddFunc
+	// and UpdateFunc. It reads the spec, not the status, so a container
+	// that isn't ready yet is registered at Add time all the same; its
+	// LogStreamer waits in run() until containerReady reports it. Callers
+	// must hold mu.
+	registerContainers := func(pod *v1.Pod) {
+		for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+			if regex != nil && !regex.MatchString(c.Name) {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s", pod.Name, c.Name)
+			if _, exists := lsMap[key]; !exists {
+				ls := &LogStreamer{
+					clientset:   clientset,
+					podLister:   podLister,
+					cluster:     cluster,
+					namespace:   ns,
+					pod:         pod.Name,
+					container:   c.Name,
+					nodeName:    pod.Spec.NodeName,
+					podUID:      string(pod.UID),
+					labels:      pod.Labels,
+					annotations: pod.Annotations,
+					sink:        sink,
+					health:      health,
+					stopCh:      make(chan struct{}),
+					mode:        mode,
+					sinceSec:    sinceSec,
+				}
+				ls.Start()
+				lsMap[key] = ls
+			}
+		}
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod := obj.(*v1.Pod)
+			mu.Lock()
+			defer mu.Unlock()
+			registerContainers(pod)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod := oldObj.(*v1.Pod)
+			newPod := newObj.(*v1.Pod)
+			mu.Lock()
+			defer mu.Unlock()
+
+			registerContainers(newPod)
+
+			oldStatuses := make(map[string]v1.ContainerStatus, len(oldPod.Status.ContainerStatuses))
+			for _, cs := range oldPod.Status.ContainerStatuses {
+				oldStatuses[cs.Name] = cs
+			}
+			for _, cs := range newPod.Status.ContainerStatuses {
+				old, existed := oldStatuses[cs.Name]
+				if !existed || cs.RestartCount <= old.RestartCount {
+					continue
+				}
+				key := fmt.Sprintf("%s/%s", newPod.Name, cs.Name)
+				if ls, exists := lsMap[key]; exists {
+					reason, exitCode := terminationInfo(cs)
+					go ls.fetchPrevious(cs.RestartCount, reason, exitCode)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			pod := obj.(*v1.Pod)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				key := fmt.Sprintf("%s/%s", pod.Name, c.Name)
+				if ls, exists := lsMap[key]; exists {
+					ls.Stop()
+					delete(lsMap, key)
+				}
+			}
+		},
+	}
+
+	podInformer.AddEventHandler(handler)
+
+	factoryStopCh := make(chan struct{})
+	go func() {
+		<-stopCh
+		close(factoryStopCh)
+	}()
+
+	factory.Start(factoryStopCh)
+	factory.WaitForCacheSync(factoryStopCh)
+	synced <- struct{}{}
+
+	<-factoryStopCh
+}
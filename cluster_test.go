@@ -0,0 +1,121 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// writeFakeKubeconfig writes a minimal, valid kubeconfig to path naming
+// a single cluster/context called name.
+func writeFakeKubeconfig(t *testing.T, path, name string) {
+	t.Helper()
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters[name] = &clientcmdapi.Cluster{Server: "https://" + name + ".example.com"}
+	cfg.Contexts[name] = &clientcmdapi.Context{Cluster: name}
+	cfg.CurrentContext = name
+	if err := clientcmd.WriteToFile(*cfg, path); err != nil {
+		t.Fatalf("write fake kubeconfig %s: %v", path, err)
+	}
+}
+
+func TestBuildClusterConfigsFromDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeKubeconfig(t, filepath.Join(dir, "east.yaml"), "east")
+	writeFakeKubeconfig(t, filepath.Join(dir, "west.yaml"), "west")
+
+	configs, err := buildClusterConfigsFromDir(dir)
+	if err != nil {
+		t.Fatalf("buildClusterConfigsFromDir: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("got %d configs, want 2", len(configs))
+	}
+	for _, name := range []string{"east", "west"} {
+		cfg, ok := configs[name]
+		if !ok {
+			t.Errorf("missing config for %q (want filename with extension stripped)", name)
+			continue
+		}
+		if cfg.Host != "https://"+name+".example.com" {
+			t.Errorf("config for %q has host %q", name, cfg.Host)
+		}
+	}
+}
+
+func TestBuildClusterConfigsFromDirEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := buildClusterConfigsFromDir(dir); err == nil {
+		t.Error("expected an error for a kubeconfig-dir with no files")
+	}
+}
+
+func TestBuildClusterConfigsSingleContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeFakeKubeconfig(t, path, "my-cluster")
+
+	configs, err := buildClusterConfigs(path, "", "")
+	if err != nil {
+		t.Fatalf("buildClusterConfigs: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("got %d configs, want 1", len(configs))
+	}
+	cfg, ok := configs["my-cluster"]
+	if !ok {
+		t.Fatalf("expected a config keyed by the current context %q, got %d configs", "my-cluster", len(configs))
+	}
+	if cfg.Host != "https://my-cluster.example.com" {
+		t.Errorf("config host = %q", cfg.Host)
+	}
+}
+
+func TestBuildClusterConfigsMultipleContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	cfg := clientcmdapi.NewConfig()
+	for _, name := range []string{"a", "b"} {
+		cfg.Clusters[name] = &clientcmdapi.Cluster{Server: "https://" + name + ".example.com"}
+		cfg.Contexts[name] = &clientcmdapi.Context{Cluster: name}
+	}
+	cfg.CurrentContext = "a"
+	if err := clientcmd.WriteToFile(*cfg, path); err != nil {
+		t.Fatalf("write fake kubeconfig: %v", err)
+	}
+
+	configs, err := buildClusterConfigs(path, "a,b", "")
+	if err != nil {
+		t.Fatalf("buildClusterConfigs: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("got %d configs, want 2", len(configs))
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, ok := configs[name]; !ok {
+			t.Errorf("missing config for context %q", name)
+		}
+	}
+}
+
+func TestBuildClusterConfigsPrefersKubeconfigDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeKubeconfig(t, filepath.Join(dir, "east.yaml"), "east")
+
+	configs, err := buildClusterConfigs("/does/not/exist", "", dir)
+	if err != nil {
+		t.Fatalf("buildClusterConfigs: %v", err)
+	}
+	if _, ok := configs["east"]; !ok {
+		t.Errorf("expected kubeconfigDir to take precedence and yield a config for %q", "east")
+	}
+}
+
+func TestBuildClusterConfigsFallsBackToInClusterConfig(t *testing.T) {
+	// With neither kubeconfig nor kubeconfigDir set, and no in-cluster
+	// environment present in this test run, this must fail rather than
+	// silently returning an empty or nil config.
+	if _, err := buildClusterConfigs("", "", ""); err == nil {
+		t.Error("expected an error resolving in-cluster config outside a cluster")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// parseLine splits a line emitted with PodLogOptions.Timestamps=true into
+// its RFC3339Nano timestamp prefix and the remaining message. If the line
+// doesn't start with a parseable timestamp (e.g. it's not actually from
+// the container runtime), ts is the zero Time and rest is the line
+// unmodified.
+func parseLine(line string) (ts time.Time, rest string) {
+	for i := 0; i < len(line); i++ {
+		if line[i] != ' ' {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			return t, line[i+1:]
+		}
+		break
+	}
+	return time.Time{}, line
+}
+
+// buildRecord turns one raw, timestamp-prefixed log line into a Record.
+// Lines that parse as a JSON object are merged into Fields; everything
+// else becomes the raw Message.
+func buildRecord(ls *LogStreamer, line string) Record {
+	ts, rest := parseLine(line)
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	record := Record{
+		Timestamp:   ts,
+		Cluster:     ls.cluster,
+		Namespace:   ls.namespace,
+		Pod:         ls.pod,
+		Container:   ls.container,
+		Node:        ls.nodeName,
+		PodUID:      ls.podUID,
+		Labels:      ls.labels,
+		Annotations: ls.annotations,
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(rest), &fields); err == nil && fields != nil {
+		record.Fields = fields
+	} else {
+		record.Message = rest
+	}
+	return record
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	ts := time.Date(2026, 7, 28, 12, 0, 0, 123000000, time.UTC)
+	line := ts.Format(time.RFC3339Nano) + " hello world"
+
+	gotTs, gotRest := parseLine(line)
+	if !gotTs.Equal(ts) {
+		t.Errorf("ts = %v, want %v", gotTs, ts)
+	}
+	if gotRest != "hello world" {
+		t.Errorf("rest = %q, want %q", gotRest, "hello world")
+	}
+}
+
+func TestParseLineNoTimestamp(t *testing.T) {
+	gotTs, gotRest := parseLine("not a timestamp prefixed line")
+	if !gotTs.IsZero() {
+		t.Errorf("ts = %v, want zero", gotTs)
+	}
+	if gotRest != "not a timestamp prefixed line" {
+		t.Errorf("rest = %q, want input unchanged", gotRest)
+	}
+}
+
+func TestParseLineEmpty(t *testing.T) {
+	gotTs, gotRest := parseLine("")
+	if !gotTs.IsZero() || gotRest != "" {
+		t.Errorf("parseLine(\"\") = (%v, %q), want (zero, \"\")", gotTs, gotRest)
+	}
+}
+
+func TestBuildRecordMessage(t *testing.T) {
+	ls := &LogStreamer{cluster: "c1", namespace: "ns", pod: "p", container: "cnt"}
+	ts := time.Now().UTC()
+	line := ts.Format(time.RFC3339Nano) + " plain text line"
+
+	record := buildRecord(ls, line)
+	if record.Message != "plain text line" {
+		t.Errorf("Message = %q, want %q", record.Message, "plain text line")
+	}
+	if record.Fields != nil {
+		t.Errorf("Fields = %v, want nil", record.Fields)
+	}
+	if record.Cluster != "c1" || record.Namespace != "ns" || record.Pod != "p" || record.Container != "cnt" {
+		t.Errorf("record metadata not copied from LogStreamer: %+v", record)
+	}
+}
+
+func TestBuildRecordJSON(t *testing.T) {
+	ls := &LogStreamer{namespace: "ns", pod: "p", container: "cnt"}
+	ts := time.Now().UTC()
+	line := ts.Format(time.RFC3339Nano) + ` {"level":"info","msg":"started"}`
+
+	record := buildRecord(ls, line)
+	if record.Message != "" {
+		t.Errorf("Message = %q, want empty", record.Message)
+	}
+	if record.Fields["level"] != "info" || record.Fields["msg"] != "started" {
+		t.Errorf("Fields = %v, want level=info msg=started", record.Fields)
+	}
+}
+
+func TestBuildRecordNoTimestampFallsBackToNow(t *testing.T) {
+	ls := &LogStreamer{namespace: "ns", pod: "p", container: "cnt"}
+	before := time.Now()
+	record := buildRecord(ls, "no timestamp here")
+	after := time.Now()
+
+	if record.Timestamp.Before(before) || record.Timestamp.After(after) {
+		t.Errorf("Timestamp = %v, want between %v and %v", record.Timestamp, before, after)
+	}
+	if record.Message != "no timestamp here" {
+		t.Errorf("Message = %q, want input unchanged", record.Message)
+	}
+}
@@ -2,79 +2,71 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"regexp"
-	"sync"
+	"strings"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
+	corelisters "k8s.io/client-go/listers/core/v1"
 )
 
-// HTTPSender posts log lines to a remote HTTP endpoint.
-type HTTPSender struct {
-	url     string
-	client  *http.Client
-	lastErr time.Time
-}
-
 const errorLogInterval = 30 * time.Second
 
-// NewHTTPSender initializes an HTTPSender with a timeout.
-func NewHTTPSender(url string) *HTTPSender {
-	return &HTTPSender{url: url, client: &http.Client{Timeout: 5 * time.Second}}
-}
-
-// Write sends a log line to the remote endpoint.
-func (h *HTTPSender) Write(p []byte) {
-	req, err := http.NewRequest("POST", h.url, bytes.NewReader(p))
-	if err != nil {
-		log.Printf("create request error: %v", err)
-		return
-	}
-	resp, err := h.client.Do(req)
-	if err != nil {
-		if time.Since(h.lastErr) > errorLogInterval {
-			log.Printf("send error: %v", err)
-			h.lastErr = time.Now()
-		}
-		return
-	}
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
-}
-
-// LogStreamer streams logs for one pod/container based on mode.
+// LogStreamer streams logs for one pod/container based on mode. The pod
+// metadata fields are captured once from the informer cache when the
+// stream is created rather than refetched per line.
 type LogStreamer struct {
-	clientset *kubernetes.Clientset
-	namespace string
-	pod       string
-	container string
-	sender    *HTTPSender
-	stopCh    chan struct{}
-	lastErr   time.Time
-	mode      string
-	sinceSec  int64
+	clientset   *kubernetes.Clientset
+	podLister   corelisters.PodLister
+	cluster     string
+	namespace   string
+	pod         string
+	container   string
+	nodeName    string
+	podUID      string
+	labels      map[string]string
+	annotations map[string]string
+	sink        Sink
+	health      *healthServer
+	stopCh      chan struct{}
+	lastErr     time.Time
+	lastSendErr time.Time
+	mode        string
+	sinceSec    int64
 }
 
 // Start begins the log streaming in a goroutine.
 func (ls *LogStreamer) Start() {
+	streamsActive.WithLabelValues(ls.cluster, ls.namespace).Inc()
 	go ls.run()
 }
 
+// containerReady reports whether ls's container is running or ready, per
+// the informer's cached pod. A container that hasn't started yet (or has
+// terminated and not yet been recreated) isn't worth retrying against.
+func (ls *LogStreamer) containerReady() bool {
+	pod, err := ls.podLister.Pods(ls.namespace).Get(ls.pod)
+	if err != nil {
+		return false
+	}
+	for _, cs := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if cs.Name == ls.container {
+			return cs.Ready || cs.State.Running != nil
+		}
+	}
+	return false
+}
+
 // run continuously fetches logs per the configured mode.
 func (ls *LogStreamer) run() {
+	attempted := false
 	for {
 		select {
 		case <-ls.stopCh:
@@ -82,8 +74,20 @@ func (ls *LogStreamer) run() {
 		default:
 		}
 
-		// Build PodLogOptions based on mode
-		opts := &v1.PodLogOptions{Container: ls.container, Follow: true}
+		if !ls.containerReady() {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		if attempted {
+			streamRestartsTotal.Inc()
+		}
+		attempted = true
+
+		// Build PodLogOptions based on mode. Timestamps are requested so
+		// the RFC3339 prefix Kubernetes adds to each line can be parsed
+		// into Record.Timestamp instead of stamping with our own clock.
+		opts := &v1.PodLogOptions{Container: ls.container, Follow: true, Timestamps: true}
 		switch ls.mode {
 		case "real":
 			// Only new logs from now onward
@@ -100,6 +104,7 @@ func (ls *LogStreamer) run() {
 		req := ls.clientset.CoreV1().Pods(ls.namespace).GetLogs(ls.pod, opts)
 		stream, err := req.Stream(context.Background())
 		if err != nil {
+			sendErrorsTotal.WithLabelValues("stream").Inc()
 			if time.Since(ls.lastErr) > errorLogInterval {
 				log.Printf("log stream error for %s/%s: %v", ls.pod, ls.container, err)
 				ls.lastErr = time.Now()
@@ -110,12 +115,28 @@ func (ls *LogStreamer) run() {
 
 		scanner := bufio.NewScanner(stream)
 		for scanner.Scan() {
-			line := fmt.Sprintf("%s/%s %s\n", ls.pod, ls.container, scanner.Text())
-			ls.sender.Write([]byte(line))
+			record := buildRecord(ls, scanner.Text())
+			linesTotal.WithLabelValues(ls.cluster, ls.pod, ls.container).Inc()
+			bytesTotal.Add(float64(len(scanner.Bytes())))
+
+			start := time.Now()
+			err := ls.sink.Write(context.Background(), record)
+			sendLatencySeconds.Observe(time.Since(start).Seconds())
+			if ls.health != nil {
+				ls.health.recordSend(err)
+			}
+			if err != nil {
+				sendErrorsTotal.WithLabelValues("send").Inc()
+				if time.Since(ls.lastSendErr) > errorLogInterval {
+					log.Printf("send error for %s/%s: %v", ls.pod, ls.container, err)
+					ls.lastSendErr = time.Now()
+				}
+			}
 		}
 		stream.Close()
 
 		if err := scanner.Err(); err != nil {
+			sendErrorsTotal.WithLabelValues("scanner").Inc()
 			if time.Since(ls.lastErr) > errorLogInterval {
 				log.Printf("scanner error for %s/%s: %v", ls.pod, ls.container, err)
 				ls.lastErr = time.Now()
@@ -129,16 +150,100 @@ func (ls *LogStreamer) run() {
 // Stop terminates the log streaming.
 func (ls *LogStreamer) Stop() {
 	close(ls.stopCh)
+	streamsActive.WithLabelValues(ls.cluster, ls.namespace).Dec()
+}
+
+// fetchPrevious drains whatever the just-terminated instance of ls's
+// container logged before it restarted, tagging each record with
+// previous=true, the restart count it terminated at, and (when known)
+// its termination reason and exit code. It runs once and returns; the
+// regular follow stream in run() picks up the replacement instance on
+// its own once containerReady reports it.
+func (ls *LogStreamer) fetchPrevious(restartCount int32, termReason string, exitCode int32) {
+	opts := &v1.PodLogOptions{Container: ls.container, Previous: true, Timestamps: true}
+	req := ls.clientset.CoreV1().Pods(ls.namespace).GetLogs(ls.pod, opts)
+	stream, err := req.Stream(context.Background())
+	if err != nil {
+		log.Printf("previous log fetch error for %s/%s: %v", ls.pod, ls.container, err)
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		record := buildRecord(ls, scanner.Text())
+		record.Previous = true
+		record.RestartCount = restartCount
+		record.TermReason = termReason
+		record.ExitCode = exitCode
+		if err := ls.sink.Write(context.Background(), record); err != nil {
+			log.Printf("send error for previous logs of %s/%s: %v", ls.pod, ls.container, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("previous log scanner error for %s/%s: %v", ls.pod, ls.container, err)
+	}
+}
+
+// newSink builds the configured Sink from flags/environment. spoolDir
+// and spoolMaxBytes are only consulted for sink=ws, which spools
+// overflow directly since it isn't wrapped in a BatchSink.
+func newSink(sinkType, remoteURL, esIndex, kafkaBrokers, kafkaTopic, spoolDir string, spoolMaxBytes int64) (Sink, error) {
+	switch sinkType {
+	case "http":
+		if remoteURL == "" {
+			return nil, fmt.Errorf("remote-url must be specified for sink=http")
+		}
+		return NewHTTPSink(remoteURL), nil
+	case "loki":
+		if remoteURL == "" {
+			return nil, fmt.Errorf("remote-url must be specified for sink=loki")
+		}
+		return NewLokiSink(remoteURL), nil
+	case "es":
+		if remoteURL == "" {
+			return nil, fmt.Errorf("remote-url must be specified for sink=es")
+		}
+		return NewElasticsearchSink(remoteURL, esIndex), nil
+	case "kafka":
+		if kafkaBrokers == "" {
+			return nil, fmt.Errorf("kafka-brokers must be specified for sink=kafka")
+		}
+		return NewKafkaSink(strings.Split(kafkaBrokers, ","), kafkaTopic), nil
+	case "ws":
+		if remoteURL == "" {
+			return nil, fmt.Errorf("remote-url must be specified for sink=ws")
+		}
+		return NewWebSocketSink(remoteURL, spoolDir, spoolMaxBytes)
+	case "stdout":
+		return NewStdoutSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("invalid sink: %s", sinkType)
+	}
 }
 
 func main() {
 	// Flags and environment defaults
 	ns := flag.String("namespace", os.Getenv("TARGET_NAMESPACE"), "Kubernetes namespace to watch")
-	rm := flag.String("remote-url", os.Getenv("REMOTE_URL"), "HTTP endpoint to send logs")
+	rm := flag.String("remote-url", os.Getenv("REMOTE_URL"), "Remote endpoint for sink=http|loki|es|ws")
 	selector := flag.String("selector", os.Getenv("LABEL_SELECTOR"), "Label selector for pods")
 	containerRegexStr := flag.String("container-regex", os.Getenv("CONTAINER_REGEX"), "Regex to match container names")
 	mode := flag.String("mode", "all", "Log mode: 'all', 'real', or 'since'")
 	sinceSec := flag.Int64("since", 0, "When mode='since', stream logs newer than this many seconds before now")
+	sinkType := flag.String("sink", "http", "Output sink: 'http', 'loki', 'es', 'kafka', 'ws', or 'stdout'")
+	esIndex := flag.String("es-index", "k8s-logs", "Elasticsearch index name, for sink=es")
+	kafkaBrokers := flag.String("kafka-brokers", os.Getenv("KAFKA_BROKERS"), "Comma-separated Kafka broker addresses, for sink=kafka")
+	kafkaTopic := flag.String("kafka-topic", "k8s-logs", "Kafka topic, for sink=kafka")
+	batchSize := flag.Int("batch-size", 100, "Flush a batch after this many buffered records")
+	batchInterval := flag.Duration("batch-interval", 2*time.Second, "Flush a batch after this much time, even if batch-size isn't reached")
+	maxRetries := flag.Int("max-retries", 5, "Retries with exponential backoff before a batch is spooled to disk")
+	spoolDir := flag.String("spool-dir", os.Getenv("SPOOL_DIR"), "Directory for the on-disk overflow spool; disabled if empty")
+	spoolMaxBytes := flag.Int64("spool-max-bytes", 256*1024*1024, "Maximum size of each hourly spool segment, in bytes")
+	metricsAddr := flag.String("metrics-addr", ":9090", "Address to serve /metrics, /healthz, and /readyz on")
+	errorRateThreshold := flag.Float64("error-rate-threshold", 0.5, "Fail /healthz once the sink error rate over the last minute exceeds this fraction; 0 disables the check")
+	kubeconfig := flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "Path to a kubeconfig file; falls back to the in-cluster config if unset")
+	contexts := flag.String("context", "", "Comma-separated kubeconfig contexts to fan in from, all read from --kubeconfig; defaults to the current context")
+	kubeconfigDir := flag.String("kubeconfig-dir", "", "Directory of kubeconfig files, one per cluster, for fanning in clusters that don't share a kubeconfig; overrides --kubeconfig/--context")
 	flag.Parse()
 
 	// Validate flags
@@ -148,18 +253,38 @@ func main() {
 	if *mode == "since" && *sinceSec <= 0 {
 		log.Fatalf("--since must be > 0 when mode='since'")
 	}
-	if *ns == "" || *rm == "" {
-		log.Fatalf("namespace and remote-url must be specified")
+	if *ns == "" {
+		log.Fatalf("namespace must be specified")
 	}
 
-	// Kubernetes client
-	cfg, err := rest.InClusterConfig()
+	// Start health before building the sink: NewBatchSink and
+	// NewWebSocketSink both replay the on-disk spool synchronously, which
+	// can take a while if the remote has been down and a backlog piled
+	// up. Starting /healthz and /readyz first means kubelet probes still
+	// get an answer during that replay instead of failing and restarting
+	// the pod mid-backlog.
+	health := newHealthServer(*errorRateThreshold)
+	health.Start(*metricsAddr)
+
+	sink, err := newSink(*sinkType, *rm, *esIndex, *kafkaBrokers, *kafkaTopic, *spoolDir, *spoolMaxBytes)
 	if err != nil {
-		log.Fatalf("cannot get in-cluster config: %v", err)
+		log.Fatalf("%v", err)
+	}
+	// WebSocketSink already buffers, retries, and spools overflow on its
+	// own; wrapping it in BatchSink would add artificial latency per
+	// record and a second, smaller, conflicting buffer on top, defeating
+	// the point of a persistent streaming connection.
+	if *sinkType != "ws" {
+		sink, err = NewBatchSink(sink, *batchSize, *batchInterval, *maxRetries, *spoolDir, *spoolMaxBytes)
+		if err != nil {
+			log.Fatalf("cannot start batch sink: %v", err)
+		}
 	}
-	clientset, err := kubernetes.NewForConfig(cfg)
+	defer sink.Close()
+
+	clusterConfigs, err := buildClusterConfigs(*kubeconfig, *contexts, *kubeconfigDir)
 	if err != nil {
-		log.Fatalf("cannot create clientset: %v", err)
+		log.Fatalf("cannot resolve cluster configs: %v", err)
 	}
 
 	// Container name regex
@@ -171,71 +296,23 @@ func main() {
 		}
 	}
 
-	// HTTP sender
-	sender := NewHTTPSender(*rm)
-
-	// Map to track active streams
-	lsMap := make(map[string]*LogStreamer)
-	var mu sync.Mutex
-
-	// Pod informer factory
-	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
-		informers.WithNamespace(*ns),
-		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
-			if *selector != "" {
-				o.LabelSelector = *selector
-			}
-		}),
-	)
-	podInformer := factory.Core().V1().Pods().Informer()
-
-	// Event handlers for pod add/delete
-	handler := cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			pod := obj.(*v1.Pod)
-			mu.Lock()
-			defer mu.Unlock()
-			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
-				if regex != nil && !regex.MatchString(c.Name) {
-					continue
-				}
-				key := fmt.Sprintf("%s/%s", pod.Name, c.Name)
-				if _, exists := lsMap[key]; !exists {
-					ls := &LogStreamer{
-						clientset: clientset,
-						namespace: *ns,
-						pod:       pod.Name,
-						container: c.Name,
-						sender:    sender,
-						stopCh:    make(chan struct{}),
-						mode:      *mode,
-						sinceSec:  *sinceSec,
-					}
-					ls.Start()
-					lsMap[key] = ls
-				}
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			pod := obj.(*v1.Pod)
-			mu.Lock()
-			defer mu.Unlock()
-			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
-				key := fmt.Sprintf("%s/%s", pod.Name, c.Name)
-				if ls, exists := lsMap[key]; exists {
-					ls.Stop()
-					delete(lsMap, key)
-				}
-			}
-		},
+	stopCh := make(chan struct{})
+	synced := make(chan struct{}, len(clusterConfigs))
+	for name, cfg := range clusterConfigs {
+		clientset, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			log.Fatalf("cannot create clientset for cluster %s: %v", name, err)
+		}
+		go runCluster(name, clientset, *ns, *selector, regex, *mode, *sinceSec, sink, health, synced, stopCh)
 	}
 
-	podInformer.AddEventHandler(handler)
-
-	// Start informer
-	stopCh := make(chan struct{})
-	factory.Start(stopCh)
-	factory.WaitForCacheSync(stopCh)
+	// Readiness only flips once every cluster's cache has synced.
+	go func() {
+		for range clusterConfigs {
+			<-synced
+		}
+		health.setReady(true)
+	}()
 
 	// Block forever
 	<-stopCh
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	streamsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "logforwarder_streams_active",
+		Help: "Number of log streams currently running, by cluster and namespace.",
+	}, []string{"cluster", "namespace"})
+
+	linesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logforwarder_lines_total",
+		Help: "Total number of log lines forwarded, by cluster, pod, and container.",
+	}, []string{"cluster", "pod", "container"})
+
+	bytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "logforwarder_bytes_total",
+		Help: "Total number of log bytes forwarded.",
+	})
+
+	sendErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logforwarder_send_errors_total",
+		Help: "Total number of forwarding errors, by kind (stream, scanner, send).",
+	}, []string{"kind"})
+
+	sendLatencySeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "logforwarder_send_latency_seconds",
+		Help:    "Latency of sink writes.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	streamRestartsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "logforwarder_stream_restarts_total",
+		Help: "Total number of times a log stream reconnected after an error.",
+	})
+
+	spoolBytesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "logforwarder_spool_bytes",
+		Help: "Current size of the on-disk overflow spool, in bytes. Zero if spooling is disabled.",
+	})
+)
+
+// errorRateTracker tracks the fraction of sink writes that failed over a
+// sliding one-minute window, bucketed per second.
+type errorRateTracker struct {
+	mu     sync.Mutex
+	second int64
+	idx    int
+	total  [60]int64
+	errors [60]int64
+}
+
+func (t *errorRateTracker) record(isErr bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advance(time.Now().Unix())
+	t.total[t.idx]++
+	if isErr {
+		t.errors[t.idx]++
+	}
+}
+
+// advance rolls the ring buffer forward to now, zeroing any buckets the
+// window has moved past. Must be called with mu held.
+func (t *errorRateTracker) advance(now int64) {
+	if t.second == 0 {
+		t.second = now
+		return
+	}
+	diff := now - t.second
+	if diff <= 0 {
+		return
+	}
+	if diff > int64(len(t.total)) {
+		diff = int64(len(t.total))
+	}
+	for i := int64(0); i < diff; i++ {
+		t.idx = (t.idx + 1) % len(t.total)
+		t.total[t.idx] = 0
+		t.errors[t.idx] = 0
+	}
+	t.second = now
+}
+
+func (t *errorRateTracker) rate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advance(time.Now().Unix())
+	var total, errs int64
+	for i := range t.total {
+		total += t.total[i]
+		errs += t.errors[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(errs) / float64(total)
+}
+
+// healthServer exposes Prometheus metrics plus /healthz and /readyz for
+// use as Kubernetes liveness/readiness probes. Readiness flips to true
+// only once the informer caches have synced; liveness fails once the
+// sink's recent error rate crosses errorRateThreshold.
+type healthServer struct {
+	ready              int32
+	errRate            errorRateTracker
+	errorRateThreshold float64
+}
+
+// newHealthServer returns a healthServer that fails /healthz once the
+// sink's error rate over the last minute exceeds errorRateThreshold. A
+// non-positive threshold disables the liveness check.
+func newHealthServer(errorRateThreshold float64) *healthServer {
+	return &healthServer{errorRateThreshold: errorRateThreshold}
+}
+
+// setReady marks the server ready (or not) for /readyz.
+func (h *healthServer) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&h.ready, v)
+}
+
+// recordSend feeds a sink.Write outcome into the liveness error rate.
+func (h *healthServer) recordSend(err error) {
+	h.errRate.record(err != nil)
+}
+
+func (h *healthServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if h.errorRateThreshold > 0 && h.errRate.rate() > h.errorRateThreshold {
+			http.Error(w, "send error rate too high", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&h.ready) == 0 {
+			http.Error(w, "caches not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// Start runs the metrics/health HTTP server in a goroutine.
+func (h *healthServer) Start(addr string) {
+	srv := &http.Server{Addr: addr, Handler: h.handler()}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics server error: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorRateTrackerRate(t *testing.T) {
+	var tr errorRateTracker
+	now := time.Now().Unix()
+
+	tr.advance(now)
+	tr.total[tr.idx]++
+	tr.total[tr.idx]++
+	tr.errors[tr.idx]++
+
+	if got, want := tr.rate(), 0.5; got != want {
+		t.Errorf("rate() = %v, want %v", got, want)
+	}
+}
+
+func TestErrorRateTrackerNoSamples(t *testing.T) {
+	var tr errorRateTracker
+	if got := tr.rate(); got != 0 {
+		t.Errorf("rate() with no samples = %v, want 0", got)
+	}
+}
+
+func TestErrorRateTrackerAdvanceZeroesOldBuckets(t *testing.T) {
+	var tr errorRateTracker
+	tr.advance(1000)
+	tr.total[tr.idx] = 5
+	tr.errors[tr.idx] = 5
+
+	// Advancing by one second should roll onto a fresh bucket, leaving
+	// the previous second's samples in the window but not overwritten.
+	tr.advance(1001)
+	if tr.total[tr.idx] != 0 || tr.errors[tr.idx] != 0 {
+		t.Errorf("new bucket not zeroed: total=%d errors=%d", tr.total[tr.idx], tr.errors[tr.idx])
+	}
+
+	// Advancing past the full window should zero every bucket, since
+	// nothing in the old window is still relevant.
+	tr.advance(1000 + int64(len(tr.total)) + 10)
+	var total, errs int64
+	for i := range tr.total {
+		total += tr.total[i]
+		errs += tr.errors[i]
+	}
+	if total != 0 || errs != 0 {
+		t.Errorf("buckets not cleared after advancing past window: total=%d errors=%d", total, errs)
+	}
+}
+
+func TestErrorRateTrackerAdvanceNonPositiveDiffIsNoop(t *testing.T) {
+	var tr errorRateTracker
+	tr.advance(1000)
+	tr.total[tr.idx] = 3
+	idxBefore := tr.idx
+
+	tr.advance(999) // clock moved backwards: must not roll the window
+	if tr.idx != idxBefore || tr.total[idxBefore] != 3 {
+		t.Errorf("advance with non-positive diff mutated state: idx=%d total=%d", tr.idx, tr.total[idxBefore])
+	}
+}
+
+func TestErrorRateTrackerRecordAndRate(t *testing.T) {
+	var tr errorRateTracker
+	tr.record(false)
+	tr.record(false)
+	tr.record(true)
+
+	if got, want := tr.rate(), 1.0/3.0; got != want {
+		t.Errorf("rate() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Record is a single log line enriched with Kubernetes metadata and
+// whatever structured fields could be extracted from the line itself.
+// Message holds the raw line when it isn't JSON; Fields holds the
+// decoded object when it is.
+type Record struct {
+	Timestamp    time.Time              `json:"timestamp"`
+	Cluster      string                 `json:"cluster,omitempty"`
+	Namespace    string                 `json:"namespace"`
+	Pod          string                 `json:"pod"`
+	Container    string                 `json:"container"`
+	Node         string                 `json:"node_name,omitempty"`
+	PodUID       string                 `json:"pod_uid,omitempty"`
+	Labels       map[string]string      `json:"labels,omitempty"`
+	Annotations  map[string]string      `json:"annotations,omitempty"`
+	Message      string                 `json:"message,omitempty"`
+	Fields       map[string]interface{} `json:"fields,omitempty"`
+	Previous     bool                   `json:"previous,omitempty"`
+	RestartCount int32                  `json:"restart_count,omitempty"`
+	TermReason   string                 `json:"termination_reason,omitempty"`
+	ExitCode     int32                  `json:"exit_code,omitempty"`
+}
+
+// Sink is the destination for log records. Implementations may batch,
+// retry, or reorder writes internally, but Flush must block until
+// everything handed to Write so far has either been delivered, been
+// spooled to disk, or permanently failed, and Close must release any
+// underlying resources.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+	Flush() error
+	Close() error
+}
+
+// PermanentError marks a Write/WriteBatch failure as one a retry
+// wouldn't fix (e.g. the remote rejected the payload itself with a 4xx
+// response), as opposed to a transient one (5xx, network errors).
+// BatchSink stops retrying a batch as soon as it sees one, rather than
+// burning all its retries and then spooling a doomed batch to disk,
+// where it would just fail and re-spool forever on every replay.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// IsPermanent reports whether err is (or wraps) a *PermanentError.
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
+// httpStatusErr turns a non-2xx resp into an error for remote, marking
+// client errors (4xx, aside from 429 which just means "slow down") as
+// permanent: the payload itself was rejected, so retrying it unchanged
+// wouldn't help.
+func httpStatusErr(remote string, resp *http.Response) error {
+	err := fmt.Errorf("%s returned status %s", remote, resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
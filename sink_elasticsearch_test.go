@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestElasticsearchSinkWriteBatchPacksOneActionDocPairPerRecord(t *testing.T) {
+	var body bytes.Buffer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := body.ReadFrom(r.Body); err != nil {
+			t.Errorf("read posted body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	e := NewElasticsearchSink(srv.URL, "logs")
+	records := []Record{
+		{Pod: "a", Message: "one"},
+		{Pod: "b", Message: "two"},
+	}
+	if err := e.WriteBatch(context.Background(), records); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+
+	scanner := bufio.NewScanner(&body)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d NDJSON lines, want 4 (action+doc per record)", len(lines))
+	}
+	for i, r := range records {
+		var action map[string]map[string]string
+		if err := json.Unmarshal([]byte(lines[i*2]), &action); err != nil {
+			t.Fatalf("line %d isn't a valid action: %v", i*2, err)
+		}
+		if action["index"]["_index"] != "logs" {
+			t.Errorf("line %d index = %q, want logs", i*2, action["index"]["_index"])
+		}
+		var doc Record
+		if err := json.Unmarshal([]byte(lines[i*2+1]), &doc); err != nil {
+			t.Fatalf("line %d isn't a valid doc: %v", i*2+1, err)
+		}
+		if doc.Pod != r.Pod {
+			t.Errorf("line %d pod = %q, want %q", i*2+1, doc.Pod, r.Pod)
+		}
+	}
+}
+
+func TestElasticsearchSinkWriteBatchPropagatesPermanentError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	e := NewElasticsearchSink(srv.URL, "logs")
+	err := e.WriteBatch(context.Background(), []Record{{Pod: "a"}})
+	if err == nil || !IsPermanent(err) {
+		t.Errorf("WriteBatch with a 400 response = %v, want a permanent error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSink posts log records to a remote HTTP endpoint. It is the
+// default sink. Write sends one record as a single JSON document per
+// request; WriteBatch sends many records as one NDJSON request.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink initializes an HTTPSink with a timeout.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Write POSTs record as JSON to the configured URL.
+func (h *HTTPSink) Write(ctx context.Context, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return httpStatusErr("remote", resp)
+	}
+	return nil
+}
+
+// WriteBatch POSTs all records as a single NDJSON-encoded body, letting
+// BatchSink amortize one HTTP request (and TLS handshake) across many
+// lines instead of issuing one request per record.
+func (h *HTTPSink) WriteBatch(ctx context.Context, records []Record) error {
+	var buf bytes.Buffer
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("marshal record: %w", err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, &buf)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return httpStatusErr("remote", resp)
+	}
+	return nil
+}
+
+func (h *HTTPSink) Flush() error { return nil }
+
+func (h *HTTPSink) Close() error { return nil }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink publishes records as JSON messages to a Kafka topic, keyed
+// by namespace/pod/container so that logs from a given container land
+// on the same partition and keep their relative order.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaSink returns a KafkaSink producing to topic on the given
+// broker addresses.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{writer: &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+	}}
+}
+
+// Write produces record to the configured topic.
+func (k *KafkaSink) Write(ctx context.Context, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	return k.writer.WriteMessages(ctx, kafka.Message{Key: kafkaKey(record), Value: b})
+}
+
+// kafkaKey returns the partition key for record: namespace/pod/container,
+// so that every record from a given container lands on the same
+// partition and keeps its relative order.
+func kafkaKey(record Record) []byte {
+	return []byte(record.Namespace + "/" + record.Pod + "/" + record.Container)
+}
+
+func (k *KafkaSink) Flush() error { return nil }
+
+func (k *KafkaSink) Close() error {
+	return k.writer.Close()
+}
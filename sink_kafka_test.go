@@ -0,0 +1,10 @@
+package main
+
+import "testing"
+
+func TestKafkaKey(t *testing.T) {
+	got := kafkaKey(Record{Namespace: "ns", Pod: "p", Container: "c"})
+	if want := "ns/p/c"; string(got) != want {
+		t.Errorf("kafkaKey = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LokiSink pushes records to a Grafana Loki instance via the
+// /loki/api/v1/push endpoint. Streams are keyed by
+// namespace/pod/container only: pod labels are high-cardinality and
+// churn per rollout (pod-template-hash and the like), so indexing them
+// as stream labels would blow up Loki's stream cardinality. They're
+// carried in the line body instead.
+type LokiSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewLokiSink returns a LokiSink posting to the given Loki base URL,
+// e.g. "http://loki:3100".
+func NewLokiSink(baseURL string) *LokiSink {
+	return &LokiSink{url: baseURL + "/loki/api/v1/push", client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Write pushes record as a single-entry Loki stream.
+func (l *LokiSink) Write(ctx context.Context, record Record) error {
+	labels := map[string]string{
+		"namespace": record.Namespace,
+		"pod":       record.Pod,
+		"container": record.Container,
+	}
+	ts := record.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	line, err := lokiLine(record)
+	if err != nil {
+		return err
+	}
+	body := lokiPushRequest{Streams: []lokiStream{{
+		Stream: labels,
+		Values: [][2]string{{strconv.FormatInt(ts.UnixNano(), 10), line}},
+	}}}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal loki push request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return httpStatusErr("loki", resp)
+	}
+	return nil
+}
+
+// WriteBatch groups records into one Loki stream per namespace/pod/
+// container, appending each record as a [timestamp, line] value, and
+// pushes them all in a single request instead of one per record.
+func (l *LokiSink) WriteBatch(ctx context.Context, records []Record) error {
+	streams := make(map[string]*lokiStream)
+	order := make([]string, 0, len(records))
+	for _, record := range records {
+		key := record.Namespace + "/" + record.Pod + "/" + record.Container
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: map[string]string{
+				"namespace": record.Namespace,
+				"pod":       record.Pod,
+				"container": record.Container,
+			}}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		ts := record.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		line, err := lokiLine(record)
+		if err != nil {
+			return err
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), line})
+	}
+
+	body := lokiPushRequest{Streams: make([]lokiStream, 0, len(order))}
+	for _, key := range order {
+		body.Streams = append(body.Streams, *streams[key])
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal loki push request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return httpStatusErr("loki", resp)
+	}
+	return nil
+}
+
+// lokiLine renders record's log line body: the decoded JSON fields (or
+// raw message) plus, if present, the pod's labels under a nested key so
+// they stay searchable without becoming indexed stream labels.
+func lokiLine(record Record) (string, error) {
+	if len(record.Labels) == 0 {
+		if record.Fields == nil {
+			return record.Message, nil
+		}
+		b, err := json.Marshal(record.Fields)
+		if err != nil {
+			return "", fmt.Errorf("marshal record fields: %w", err)
+		}
+		return string(b), nil
+	}
+
+	fields := make(map[string]interface{}, len(record.Fields)+1)
+	for k, v := range record.Fields {
+		fields[k] = v
+	}
+	if record.Fields == nil {
+		fields["message"] = record.Message
+	}
+	fields["pod_labels"] = record.Labels
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("marshal record fields: %w", err)
+	}
+	return string(b), nil
+}
+
+func (l *LokiSink) Flush() error { return nil }
+
+func (l *LokiSink) Close() error { return nil }
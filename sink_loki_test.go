@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLokiLineMessageOnly(t *testing.T) {
+	got, err := lokiLine(Record{Message: "hello"})
+	if err != nil {
+		t.Fatalf("lokiLine: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("lokiLine = %q, want %q", got, "hello")
+	}
+}
+
+func TestLokiLineFieldsNoLabels(t *testing.T) {
+	got, err := lokiLine(Record{Fields: map[string]interface{}{"level": "info"}})
+	if err != nil {
+		t.Fatalf("lokiLine: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("lokiLine output isn't valid JSON: %v", err)
+	}
+	if decoded["level"] != "info" {
+		t.Errorf("decoded = %+v, want level=info", decoded)
+	}
+	if _, ok := decoded["pod_labels"]; ok {
+		t.Errorf("decoded = %+v, want no pod_labels key with no Labels set", decoded)
+	}
+}
+
+func TestLokiLineFieldsAndLabels(t *testing.T) {
+	got, err := lokiLine(Record{
+		Fields: map[string]interface{}{"level": "info"},
+		Labels: map[string]string{"app": "widget"},
+	})
+	if err != nil {
+		t.Fatalf("lokiLine: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("lokiLine output isn't valid JSON: %v", err)
+	}
+	if decoded["level"] != "info" {
+		t.Errorf("decoded = %+v, want level=info", decoded)
+	}
+	labels, ok := decoded["pod_labels"].(map[string]interface{})
+	if !ok || labels["app"] != "widget" {
+		t.Errorf("decoded pod_labels = %+v, want app=widget", decoded["pod_labels"])
+	}
+}
+
+func TestLokiLineLabelsWithoutFields(t *testing.T) {
+	got, err := lokiLine(Record{
+		Message: "plain text",
+		Labels:  map[string]string{"app": "widget"},
+	})
+	if err != nil {
+		t.Fatalf("lokiLine: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("lokiLine output isn't valid JSON: %v", err)
+	}
+	if decoded["message"] != "plain text" {
+		t.Errorf("decoded = %+v, want message=\"plain text\" since Fields is nil", decoded)
+	}
+	labels, ok := decoded["pod_labels"].(map[string]interface{})
+	if !ok || labels["app"] != "widget" {
+		t.Errorf("decoded pod_labels = %+v, want app=widget", decoded["pod_labels"])
+	}
+}
+
+func TestLokiSinkWriteBatchGroupsStreamsByPodAndOrdersValues(t *testing.T) {
+	var posted lokiPushRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Errorf("decode posted body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	l := NewLokiSink(srv.URL)
+	records := []Record{
+		{Namespace: "ns", Pod: "a", Container: "c", Message: "one"},
+		{Namespace: "ns", Pod: "b", Container: "c", Message: "two"},
+		{Namespace: "ns", Pod: "a", Container: "c", Message: "three"},
+	}
+	if err := l.WriteBatch(context.Background(), records); err != nil {
+		t.Fatalf("WriteBatch: %v", err)
+	}
+
+	if len(posted.Streams) != 2 {
+		t.Fatalf("got %d streams, want 2 (one per distinct pod)", len(posted.Streams))
+	}
+	byPod := make(map[string]lokiStream, len(posted.Streams))
+	for _, s := range posted.Streams {
+		byPod[s.Stream["pod"]] = s
+	}
+	a := byPod["a"]
+	if len(a.Values) != 2 || a.Values[0][1] != "one" || a.Values[1][1] != "three" {
+		t.Errorf("stream for pod a values = %+v, want [\"one\" \"three\"] in append order", a.Values)
+	}
+	b := byPod["b"]
+	if len(b.Values) != 1 || b.Values[0][1] != "two" {
+		t.Errorf("stream for pod b values = %+v, want [\"two\"]", b.Values)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StdoutSink writes records as newline-delimited JSON to an io.Writer,
+// normally os.Stdout. It's mainly useful for local development and for
+// piping into another tool while testing a pipeline end to end.
+type StdoutSink struct {
+	w io.Writer
+}
+
+// NewStdoutSink returns a StdoutSink writing to w.
+func NewStdoutSink(w io.Writer) *StdoutSink {
+	return &StdoutSink{w: w}
+}
+
+// Write marshals record as a single line of JSON and writes it to w.
+func (s *StdoutSink) Write(_ context.Context, record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	b = append(b, '\n')
+	_, err = s.w.Write(b)
+	return err
+}
+
+func (s *StdoutSink) Flush() error { return nil }
+
+func (s *StdoutSink) Close() error { return nil }
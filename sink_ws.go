@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsFrame is the envelope sent over the WebSocket connection: each
+// record gets a monotonically increasing sequence number so the server
+// can report how far it has durably received.
+type wsFrame struct {
+	Seq    uint64 `json:"seq"`
+	Record Record `json:"record"`
+}
+
+// wsAck is sent by the server to report the highest sequence number it
+// has durably received; everything at or below that seq can be dropped
+// from the resend buffer.
+type wsAck struct {
+	Ack uint64 `json:"ack"`
+}
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 45 * time.Second
+
+	// wsMaxPending caps how many unacked records WebSocketSink holds in
+	// memory. Beyond that, a remote that's down for an extended period
+	// would otherwise grow pending without bound until the process OOMs;
+	// once the cap is hit, records overflow to the on-disk spool instead
+	// (or are rejected if spooling is disabled), the same as BatchSink.
+	wsMaxPending = 10000
+)
+
+// WebSocketSink streams records over a single long-lived WebSocket
+// connection instead of issuing one HTTP request per record or batch,
+// removing the per-line handshake overhead of HTTPSink under heavy
+// throughput. Unacknowledged records are kept in a bounded in-memory
+// buffer and replayed in order after a reconnect; once that buffer fills
+// up, records overflow to an on-disk spool (replayed back in on the next
+// start, like BatchSink's).
+type WebSocketSink struct {
+	url string
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	nextSeq uint64
+	pending []wsFrame // sent but not yet acked, oldest (lowest seq) first
+	spool   *spool    // nil if spooling is disabled
+
+	closeCh chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewWebSocketSink returns a WebSocketSink that connects to the given
+// ws:// or wss:// URL, reconnecting with exponential backoff until
+// Close is called. If spoolDir is non-empty, records that arrive once
+// the in-memory pending buffer is full are durably spooled there,
+// bounded by spoolMaxBytes per hourly segment, and any records left over
+// from a previous run are loaded back into pending before
+// NewWebSocketSink returns.
+func NewWebSocketSink(remoteURL, spoolDir string, spoolMaxBytes int64) (*WebSocketSink, error) {
+	if _, err := url.Parse(remoteURL); err != nil {
+		return nil, fmt.Errorf("invalid remote-url: %w", err)
+	}
+	w := &WebSocketSink{
+		url:     remoteURL,
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	if spoolDir != "" {
+		sp, err := newSpool(spoolDir, spoolMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("init spool: %w", err)
+		}
+		w.spool = sp
+		// A segment is only removed once its records have been handed to
+		// pending, so a crash mid-replay leaves it on disk to try again
+		// next start instead of losing records that were never loaded.
+		replayErr := sp.replay(func(records []Record) {
+			for _, r := range records {
+				w.pending = append(w.pending, wsFrame{Seq: w.nextSeq, Record: r})
+				w.nextSeq++
+			}
+		})
+		if replayErr != nil {
+			return nil, fmt.Errorf("replay spool: %w", replayErr)
+		}
+	}
+	go w.connectLoop()
+	return w, nil
+}
+
+// Write assigns record the next sequence number, buffers it for resend,
+// and sends it on the current connection if one is up. Writes never
+// block on the network: with no live connection the record just stays
+// pending until one is (re)established. Once pending reaches
+// wsMaxPending (a sustained remote outage, say), records overflow to the
+// on-disk spool instead of growing pending without bound, or are
+// rejected if spooling is disabled.
+func (w *WebSocketSink) Write(_ context.Context, record Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) >= wsMaxPending {
+		if w.spool == nil {
+			return fmt.Errorf("websocket sink buffer full and no spool configured")
+		}
+		return w.spool.append(record)
+	}
+
+	frame := wsFrame{Seq: w.nextSeq, Record: record}
+	w.nextSeq++
+	w.pending = append(w.pending, frame)
+
+	if w.conn != nil {
+		w.sendLocked(frame)
+	}
+	return nil
+}
+
+// sendLocked writes frame to the current connection, if any. Must be
+// called with mu held. A write failure just drops the connection;
+// connectLoop will reconnect and replay pending frames from there.
+func (w *WebSocketSink) sendLocked(frame wsFrame) {
+	if err := w.conn.WriteJSON(frame); err != nil {
+		log.Printf("websocket sink: write failed, dropping connection: %v", err)
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// connectLoop keeps a WebSocket connection alive, reconnecting with
+// exponential backoff and jitter whenever it drops, and replaying
+// whatever is still pending once a new connection is up.
+func (w *WebSocketSink) connectLoop() {
+	defer close(w.doneCh)
+	attempt := 0
+	for {
+		select {
+		case <-w.closeCh:
+			return
+		default:
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(w.url, nil)
+		if err != nil {
+			backoff := wsBackoff(attempt)
+			attempt++
+			log.Printf("websocket sink: dial failed, retrying in %s: %v", backoff, err)
+			select {
+			case <-time.After(backoff):
+				continue
+			case <-w.closeCh:
+				return
+			}
+		}
+		attempt = 0
+
+		w.mu.Lock()
+		w.conn = conn
+		pending := append([]wsFrame(nil), w.pending...)
+		w.mu.Unlock()
+
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+
+		for _, frame := range pending {
+			w.mu.Lock()
+			if w.conn == conn {
+				w.sendLocked(frame)
+			}
+			w.mu.Unlock()
+		}
+
+		w.pump(conn)
+
+		w.mu.Lock()
+		if w.conn == conn {
+			w.conn = nil
+		}
+		w.mu.Unlock()
+	}
+}
+
+// pump reads ack frames and sends keepalive pings until the connection
+// breaks or the sink is closed, trimming acknowledged records out of
+// pending as acks arrive.
+func (w *WebSocketSink) pump(conn *websocket.Conn) {
+	pingTicker := time.NewTicker(wsPingInterval)
+	defer pingTicker.Stop()
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			var ack wsAck
+			if err := conn.ReadJSON(&ack); err != nil {
+				return
+			}
+			w.mu.Lock()
+			w.pending = trimAcked(w.pending, ack.Ack)
+			w.mu.Unlock()
+		}
+	}()
+
+	for {
+		select {
+		case <-readDone:
+			return
+		case <-w.closeCh:
+			return
+		case <-pingTicker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// trimAcked drops every frame at or below ack from pending. pending
+// stays ordered by sequence number since frames are appended in order.
+func trimAcked(pending []wsFrame, ack uint64) []wsFrame {
+	i := 0
+	for i < len(pending) && pending[i].Seq <= ack {
+		i++
+	}
+	return pending[i:]
+}
+
+// wsBackoff returns the delay before reconnect attempt n (0-indexed),
+// with exponential growth capped at 64x the base plus up to 50% jitter.
+func wsBackoff(attempt int) time.Duration {
+	if attempt > 6 {
+		attempt = 6
+	}
+	base := (500 * time.Millisecond) << uint(attempt)
+	return base + time.Duration(rand.Int63n(int64(base)/2+1))
+}
+
+// wsFlushPollInterval is how often Flush checks whether pending has
+// drained. There's no condition variable to wake it directly since
+// pending can empty out from acks arriving on a connection that may not
+// exist yet (or may be mid-reconnect), so polling is the simplest thing
+// that covers every case.
+const wsFlushPollInterval = 50 * time.Millisecond
+
+// Flush blocks until every record held in pending has been acked or
+// Close is called, satisfying the Sink contract that Flush waits for
+// delivery (or spooling, or permanent failure) rather than returning
+// immediately. Records that Write overflowed to the spool are not waited
+// for; they stay on disk until the next start loads them.
+func (w *WebSocketSink) Flush() error {
+	ticker := time.NewTicker(wsFlushPollInterval)
+	defer ticker.Stop()
+	for {
+		w.mu.Lock()
+		drained := len(w.pending) == 0
+		w.mu.Unlock()
+		if drained {
+			return nil
+		}
+		select {
+		case <-w.closeCh:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *WebSocketSink) Close() error {
+	close(w.closeCh)
+	<-w.doneCh
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	if w.spool != nil {
+		w.spool.close()
+	}
+	return nil
+}
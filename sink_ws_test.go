@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWebSocketSinkWriteOverflowsToSpoolOncePendingIsFull(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	w := &WebSocketSink{spool: sp}
+	w.pending = make([]wsFrame, wsMaxPending)
+
+	if err := w.Write(context.Background(), Record{Pod: "overflow"}); err != nil {
+		t.Fatalf("Write once pending is full but spool is configured: %v", err)
+	}
+	if len(w.pending) != wsMaxPending {
+		t.Errorf("pending grew past wsMaxPending: %d", len(w.pending))
+	}
+
+	got, err := replayAll(sp)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(got) != 1 || got[0].Pod != "overflow" {
+		t.Errorf("expected the overflowed record to be spooled, got %+v", got)
+	}
+}
+
+func TestWebSocketSinkWriteRejectsOverflowWithoutSpool(t *testing.T) {
+	w := &WebSocketSink{}
+	w.pending = make([]wsFrame, wsMaxPending)
+
+	if err := w.Write(context.Background(), Record{Pod: "overflow"}); err == nil {
+		t.Error("expected Write to reject the record once pending is full and no spool is configured")
+	}
+	if len(w.pending) != wsMaxPending {
+		t.Errorf("pending grew past wsMaxPending: %d", len(w.pending))
+	}
+}
+
+func TestWebSocketSinkFlushWaitsForPendingToDrain(t *testing.T) {
+	w := &WebSocketSink{closeCh: make(chan struct{})}
+	w.pending = []wsFrame{{Seq: 1}}
+
+	done := make(chan error, 1)
+	go func() { done <- w.Flush() }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Flush returned %v before pending drained", err)
+	case <-time.After(2 * wsFlushPollInterval):
+	}
+
+	w.mu.Lock()
+	w.pending = nil
+	w.mu.Unlock()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Flush() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush did not return after pending drained")
+	}
+}
+
+func TestWebSocketSinkFlushReturnsOnClose(t *testing.T) {
+	w := &WebSocketSink{closeCh: make(chan struct{})}
+	w.pending = []wsFrame{{Seq: 1}}
+
+	done := make(chan error, 1)
+	go func() { done <- w.Flush() }()
+
+	close(w.closeCh)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Flush() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush did not return after close")
+	}
+}
+
+func TestTrimAcked(t *testing.T) {
+	pending := []wsFrame{{Seq: 1}, {Seq: 2}, {Seq: 3}, {Seq: 4}}
+
+	got := trimAcked(pending, 2)
+	if len(got) != 2 || got[0].Seq != 3 || got[1].Seq != 4 {
+		t.Errorf("trimAcked(pending, 2) = %+v, want frames with seq 3,4", got)
+	}
+}
+
+func TestTrimAckedNothingAcked(t *testing.T) {
+	pending := []wsFrame{{Seq: 5}, {Seq: 6}}
+	got := trimAcked(pending, 1)
+	if len(got) != 2 {
+		t.Errorf("trimAcked with ack below all seqs dropped frames: %+v", got)
+	}
+}
+
+func TestTrimAckedEverythingAcked(t *testing.T) {
+	pending := []wsFrame{{Seq: 1}, {Seq: 2}}
+	got := trimAcked(pending, 2)
+	if len(got) != 0 {
+		t.Errorf("trimAcked(pending, 2) = %+v, want empty", got)
+	}
+}
+
+func TestTrimAckedEmpty(t *testing.T) {
+	got := trimAcked(nil, 5)
+	if len(got) != 0 {
+		t.Errorf("trimAcked(nil, 5) = %+v, want empty", got)
+	}
+}
+
+func TestWsBackoffGrowsAndCaps(t *testing.T) {
+	// Without jitter, attempt n's base is 500ms<<n; the returned delay is
+	// always at least that base.
+	for attempt := 0; attempt < 10; attempt++ {
+		d := wsBackoff(attempt)
+		minExpected := 500 * time.Millisecond
+		cappedAttempt := attempt
+		if cappedAttempt > 6 {
+			cappedAttempt = 6
+		}
+		minExpected <<= uint(cappedAttempt)
+		if d < minExpected {
+			t.Errorf("wsBackoff(%d) = %v, want >= %v", attempt, d, minExpected)
+		}
+		maxExpected := minExpected + minExpected/2 + 1
+		if d > maxExpected {
+			t.Errorf("wsBackoff(%d) = %v, want <= %v", attempt, d, maxExpected)
+		}
+	}
+}
+
+func TestWsBackoffCapsAtAttemptSix(t *testing.T) {
+	// Attempts beyond 6 must not keep growing: both are capped to the
+	// same base (500ms << 6).
+	base := 500 * time.Millisecond << 6
+	for _, attempt := range []int{6, 7, 20} {
+		d := wsBackoff(attempt)
+		if d < base || d > base+base/2+1 {
+			t.Errorf("wsBackoff(%d) = %v, want within [%v, %v]", attempt, d, base, base+base/2+1)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchWriter is implemented by sinks that can deliver many records in a
+// single underlying request instead of one call per record. BatchSink
+// prefers it when available.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, records []Record) error
+}
+
+// bufferDepth bounds how many batches' worth of records BatchSink holds
+// in memory before overflowing to the on-disk spool (or, if spooling is
+// disabled, rejecting the write).
+const bufferDepth = 4
+
+// BatchSink wraps a Sink with in-memory batching and exponential-backoff
+// retries so that a brief outage of the remote endpoint doesn't drop log
+// lines. Records are flushed whenever the buffer reaches batchSize or
+// batchInterval elapses, whichever comes first. If the in-memory buffer
+// fills up, records overflow to an on-disk write-ahead log and are
+// replayed, in order, the next time BatchSink starts.
+type BatchSink struct {
+	sink          Sink
+	batchSize     int
+	batchInterval time.Duration
+	maxRetries    int
+	spool         *spool // nil if spooling is disabled
+
+	mu        sync.Mutex
+	buf       []Record
+	inflight  int // batches Write has handed to go b.flush(batch) that haven't finished yet
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+	flushesWG sync.WaitGroup // in-flight b.flush calls from Write and from loop's ticker
+}
+
+// NewBatchSink wraps sink with batching and retry. If spoolDir is
+// non-empty, overflow and failed batches are durably spooled there,
+// bounded by spoolMaxBytes per hourly segment, and any records left over
+// from a previous run are replayed before NewBatchSink returns.
+func NewBatchSink(sink Sink, batchSize int, batchInterval time.Duration, maxRetries int, spoolDir string, spoolMaxBytes int64) (*BatchSink, error) {
+	b := &BatchSink{
+		sink:          sink,
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		maxRetries:    maxRetries,
+		closeCh:       make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+	if spoolDir != "" {
+		sp, err := newSpool(spoolDir, spoolMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("init spool: %w", err)
+		}
+		b.spool = sp
+		if err := b.replaySpool(); err != nil {
+			return nil, fmt.Errorf("replay spool: %w", err)
+		}
+	}
+	go b.loop()
+	return b, nil
+}
+
+// Write buffers record for the next batch. Once the buffer fills up to
+// bufferDepth batches, records overflow to the disk spool (or are
+// rejected if spooling is disabled).
+func (b *BatchSink) Write(_ context.Context, record Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buf)+b.inflight*b.batchSize >= b.batchSize*bufferDepth {
+		if b.spool == nil {
+			return fmt.Errorf("batch sink buffer full and no spool configured")
+		}
+		return b.spool.append(record)
+	}
+
+	b.buf = append(b.buf, record)
+	if len(b.buf) >= b.batchSize {
+		batch := b.buf
+		b.buf = nil
+		b.inflight++
+		b.flushesWG.Add(1)
+		go func() {
+			defer b.flushesWG.Done()
+			b.flush(batch)
+			b.mu.Lock()
+			b.inflight--
+			b.mu.Unlock()
+		}()
+	}
+	return nil
+}
+
+// loop flushes the buffer every batchInterval and drains it on Close.
+func (b *BatchSink) loop() {
+	defer close(b.doneCh)
+	ticker := time.NewTicker(b.batchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closeCh:
+			b.flush(b.takeBuf())
+			return
+		case <-ticker.C:
+			b.flushesWG.Add(1)
+			b.flush(b.takeBuf())
+			b.flushesWG.Done()
+		}
+	}
+}
+
+func (b *BatchSink) takeBuf() []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch := b.buf
+	b.buf = nil
+	return batch
+}
+
+// flush delivers batch to the underlying sink, retrying transient
+// errors (5xx, network errors) with exponential backoff and jitter. A
+// PermanentError (e.g. a 4xx response) stops the retry loop immediately
+// since the remote will never accept this batch. If every retry attempt
+// is exhausted, the batch is spooled to disk (when spooling is enabled)
+// rather than dropped; a permanent error is dropped outright instead of
+// being spooled, since it would just fail and re-spool again on every
+// future replay.
+func (b *BatchSink) flush(batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt <= b.maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := (500 * time.Millisecond) << uint(attempt-1)
+			backoff += time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+			time.Sleep(backoff)
+		}
+		if err = b.writeBatch(batch); err == nil {
+			return
+		}
+		if IsPermanent(err) {
+			log.Printf("batch sink: permanent error, dropping %d record(s): %v", len(batch), err)
+			return
+		}
+	}
+
+	log.Printf("batch sink: giving up after %d retries: %v", b.maxRetries, err)
+	if b.spool == nil {
+		return
+	}
+	for _, r := range batch {
+		if spoolErr := b.spool.append(r); spoolErr != nil {
+			log.Printf("batch sink: spool write failed, record dropped: %v", spoolErr)
+		}
+	}
+}
+
+func (b *BatchSink) writeBatch(batch []Record) error {
+	if bw, ok := b.sink.(BatchWriter); ok {
+		return bw.WriteBatch(context.Background(), batch)
+	}
+	for _, r := range batch {
+		if err := b.sink.Write(context.Background(), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaySpool flushes any records left over from a previous run, oldest
+// first, before BatchSink starts accepting new writes. Each segment is
+// only removed from disk once every batch built from it has been
+// delivered, permanently failed, or re-spooled by flush — never merely
+// because it was read.
+func (b *BatchSink) replaySpool() error {
+	return b.spool.replay(func(records []Record) {
+		for i := 0; i < len(records); i += b.batchSize {
+			end := i + b.batchSize
+			if end > len(records) {
+				end = len(records)
+			}
+			b.flush(records[i:end])
+		}
+	})
+}
+
+// Flush delivers any buffered records immediately, waits for every
+// in-flight batch flush, whether Write or the interval ticker started it
+// (including ones still retrying), to finish, and waits for the
+// underlying sink to do the same.
+func (b *BatchSink) Flush() error {
+	b.flush(b.takeBuf())
+	b.flushesWG.Wait()
+	return b.sink.Flush()
+}
+
+// Close drains the buffer, stops the flush loop, waits for every
+// in-flight batch flush to finish, and only then closes the underlying
+// sink and spool — otherwise a flush still retrying against b.sink could
+// race with b.sink.Close() tearing it down underneath it.
+func (b *BatchSink) Close() error {
+	close(b.closeCh)
+	<-b.doneCh
+	b.flushesWG.Wait()
+	if b.spool != nil {
+		b.spool.close()
+	}
+	return b.sink.Close()
+}
+
+// spool is a bounded, on-disk write-ahead log used by BatchSink to hold
+// records that couldn't be delivered or buffered immediately. Records
+// are appended as NDJSON to an hourly segment file; each segment is
+// removed once it has been fully replayed.
+type spool struct {
+	dir      string
+	maxBytes int64
+
+	mu         sync.Mutex
+	cur        *os.File
+	curHour    string
+	size       int64
+	totalBytes int64 // across every segment on disk, reported via logforwarder_spool_bytes
+}
+
+func newSpool(dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, maxBytes: maxBytes}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "spool-") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat existing spool segment %s: %w", e.Name(), err)
+		}
+		s.totalBytes += info.Size()
+	}
+	spoolBytesGauge.Set(float64(s.totalBytes))
+
+	return s, nil
+}
+
+func (s *spool) segmentPath(hour string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("spool-%s.ndjson", hour))
+}
+
+// append writes record to the current hourly segment, rolling over to a
+// new segment when the hour changes. It fails once the current segment
+// reaches maxBytes so that a dead remote can't fill the disk.
+func (s *spool) append(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hour := time.Now().UTC().Format("2006010215")
+	if s.cur == nil || s.curHour != hour {
+		if s.cur != nil {
+			s.cur.Close()
+		}
+		f, err := os.OpenFile(s.segmentPath(hour), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open spool segment: %w", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("stat spool segment: %w", err)
+		}
+		s.cur, s.curHour, s.size = f, hour, info.Size()
+	}
+
+	if s.maxBytes > 0 && s.size >= s.maxBytes {
+		return fmt.Errorf("spool %s is full (%d bytes)", s.dir, s.maxBytes)
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	b = append(b, '\n')
+	n, err := s.cur.Write(b)
+	if err != nil {
+		return fmt.Errorf("write spool segment: %w", err)
+	}
+	s.size += int64(n)
+	s.totalBytes += int64(n)
+	spoolBytesGauge.Set(float64(s.totalBytes))
+	return nil
+}
+
+// replaySuffix marks a segment that's in the middle of being replayed:
+// renaming it out of the way before reading it means a record that gets
+// re-spooled mid-replay (e.g. a batch that exhausts its retries) lands
+// in a fresh segment under the original name instead of the one about
+// to be deleted.
+const replaySuffix = ".replaying"
+
+// replay invokes deliver once per spool segment, oldest first, with the
+// records it contains; a segment is only deleted once deliver returns,
+// so a crash mid-replay leaves it (or, if deliver had already renamed it
+// out of the way, its .replaying copy) on disk to be replayed again on
+// the next start rather than losing it. Records are delivered in the
+// order they were originally appended; a corrupt line is skipped rather
+// than losing the rest of the segment.
+func (s *spool) replay(deliver func([]Record)) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "spool-") {
+			names = append(names, e.Name())
+		}
+	}
+	// A leftover .replaying segment holds older records than a plain
+	// segment of the same hour, so it sorts (and is removed) first.
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.TrimSuffix(names[i], replaySuffix), strings.TrimSuffix(names[j], replaySuffix)
+		if a != b {
+			return a < b
+		}
+		return strings.HasSuffix(names[i], replaySuffix)
+	})
+
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		replayPath := path
+		if !strings.HasSuffix(name, replaySuffix) {
+			s.mu.Lock()
+			if s.cur != nil && s.segmentPath(s.curHour) == path {
+				s.cur.Close()
+				s.cur = nil
+			}
+			s.mu.Unlock()
+			replayPath = path + replaySuffix
+			if err := os.Rename(path, replayPath); err != nil {
+				return fmt.Errorf("stage spool segment %s for replay: %w", name, err)
+			}
+		}
+
+		records, size, err := readSegment(replayPath)
+		if err != nil {
+			return fmt.Errorf("read spool segment %s: %w", name, err)
+		}
+
+		if len(records) > 0 {
+			deliver(records)
+		}
+
+		if err := os.Remove(replayPath); err != nil {
+			return fmt.Errorf("remove replayed segment %s: %w", name, err)
+		}
+
+		s.mu.Lock()
+		s.totalBytes -= size
+		spoolBytesGauge.Set(float64(s.totalBytes))
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// readSegment decodes every NDJSON line in the file at path, skipping
+// any that don't parse, and returns the decoded records along with the
+// file's size for spool-byte accounting.
+func readSegment(path string) ([]Record, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, info.Size(), nil
+}
+
+func (s *spool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+	}
+}
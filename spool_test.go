@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+)
+
+// replayAll drains every record sp.replay hands to deliver, in the
+// order delivered, for tests that just want the flattened result.
+func replayAll(sp *spool) ([]Record, error) {
+	var got []Record
+	err := sp.replay(func(records []Record) {
+		got = append(got, records...)
+	})
+	return got, err
+}
+
+func TestSpoolAppendAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	records := []Record{
+		{Pod: "a", Message: "one"},
+		{Pod: "b", Message: "two"},
+		{Pod: "c", Message: "three"},
+	}
+	for _, r := range records {
+		if err := sp.append(r); err != nil {
+			t.Fatalf("append(%+v): %v", r, err)
+		}
+	}
+
+	got, err := replayAll(sp)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("replay returned %d records, want %d", len(got), len(records))
+	}
+	for i, r := range records {
+		if got[i].Pod != r.Pod || got[i].Message != r.Message {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], r)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected replayed segment to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestSpoolAppendRespectsMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 1)
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	if err := sp.append(Record{Message: "first"}); err != nil {
+		t.Fatalf("first append should fit under the cap check: %v", err)
+	}
+	if err := sp.append(Record{Message: "second"}); err == nil {
+		t.Error("expected append to fail once the segment is at or over maxBytes")
+	}
+}
+
+func TestSpoolReplaySkipsCorruptLines(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	if err := sp.append(Record{Message: "good"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	f, err := os.OpenFile(sp.segmentPath(sp.curHour), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	if _, err := f.WriteString("not valid json\n"); err != nil {
+		t.Fatalf("write corrupt line: %v", err)
+	}
+	f.Close()
+
+	got, err := replayAll(sp)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("replay returned %d records, want 1 (corrupt line should be skipped)", len(got))
+	}
+}
+
+// fakeSink fails its first `failures` Write calls, then succeeds.
+type fakeSink struct {
+	mu        sync.Mutex
+	failures  int
+	permanent bool
+	calls     int
+	received  []Record
+}
+
+func (f *fakeSink) Write(_ context.Context, r Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		err := errors.New("fake write failure")
+		if f.permanent {
+			return &PermanentError{Err: err}
+		}
+		return err
+	}
+	f.received = append(f.received, r)
+	return nil
+}
+
+func (f *fakeSink) Flush() error { return nil }
+func (f *fakeSink) Close() error { return nil }
+
+func TestBatchSinkFlushRetriesTransientErrors(t *testing.T) {
+	fs := &fakeSink{failures: 1}
+	b := &BatchSink{sink: fs, maxRetries: 1}
+
+	b.flush([]Record{{Pod: "p"}})
+
+	if len(fs.received) != 1 {
+		t.Fatalf("expected the batch to be delivered after a retry, got %d writes", len(fs.received))
+	}
+	if fs.calls != 2 {
+		t.Errorf("calls = %d, want 2 (1 failure + 1 retry)", fs.calls)
+	}
+}
+
+func TestBatchSinkFlushSpoolsAfterExhaustingRetries(t *testing.T) {
+	fs := &fakeSink{failures: 1000} // never succeeds
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	b := &BatchSink{sink: fs, maxRetries: 0, spool: sp}
+	b.flush([]Record{{Pod: "p"}})
+
+	got, err := replayAll(sp)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(got) != 1 || got[0].Pod != "p" {
+		t.Errorf("expected the exhausted batch to be spooled, got %+v", got)
+	}
+}
+
+func TestBatchSinkFlushDropsPermanentErrorsWithoutSpooling(t *testing.T) {
+	fs := &fakeSink{failures: 1000, permanent: true}
+	dir := t.TempDir()
+	sp, err := newSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	b := &BatchSink{sink: fs, maxRetries: 5, spool: sp}
+	b.flush([]Record{{Pod: "p"}})
+
+	if fs.calls != 1 {
+		t.Errorf("calls = %d, want 1: a permanent error should stop retrying immediately", fs.calls)
+	}
+	got, err := replayAll(sp)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected a permanently-failed batch not to be spooled, got %+v", got)
+	}
+}